@@ -0,0 +1,52 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// ociScheme is the prefix Helm uses to mark a chart reference as living in
+// an OCI registry, e.g. "oci://ghcr.io/example/charts/app".
+const ociScheme = "oci://"
+
+// loadChart resolves a chart reference and loads it, pulling it from an
+// OCI registry via the provider's configured RegistryClient when name uses
+// the oci:// scheme, and otherwise falling back to the plain
+// repository/tarball/local-path resolution ChartPathOptions already does.
+// The OCI chart is read straight out of memory rather than round-tripped
+// through a temp file.
+//
+// Any resource or data source that loads a chart (helm_release,
+// helm_template) should go through this helper so oci:// support is only
+// implemented once.
+func loadChart(m *Meta, cpo action.ChartPathOptions, name string) (*chart.Chart, error) {
+	if !strings.HasPrefix(name, ociScheme) {
+		chartPath, err := cpo.LocateChart(name, m.Settings)
+		if err != nil {
+			return nil, err
+		}
+		return loader.Load(chartPath)
+	}
+
+	if m.RegistryClient == nil {
+		return nil, fmt.Errorf("chart %q uses the oci:// scheme but no OCI registry client is configured on the provider", name)
+	}
+
+	ref := name
+	if cpo.Version != "" {
+		ref = fmt.Sprintf("%s:%s", name, cpo.Version)
+	}
+
+	result, err := m.RegistryClient.Pull(ref, registry.PullOptWithChart(true))
+	if err != nil {
+		return nil, fmt.Errorf("could not pull OCI chart %q: %s", ref, err)
+	}
+
+	return loader.LoadArchive(bytes.NewReader(result.Chart.Data))
+}
@@ -0,0 +1,258 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"gopkg.in/yaml.v2"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// dataTemplate renders a chart's manifests client-side, without requiring
+// a connection to a Kubernetes cluster or touching release storage.
+func dataTemplate() *schema.Resource {
+	return &schema.Resource{
+		Read: dataTemplateRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Release name.",
+			},
+			"repository": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Repository where to locate the requested chart.",
+			},
+			"chart": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Chart name to be rendered.",
+			},
+			"version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Specify the exact chart version to use. If this is not specified, the latest version is used.",
+			},
+			"devel": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Use chart development versions, too. Equivalent to version '>0.0.0-0'. If `version` is set, this is ignored.",
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Namespace to render the release into.",
+			},
+			"values": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "List of values in raw yaml format to pass to helm.",
+			},
+			"set": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "Custom values to be merged with the values.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"value": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"type": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"api_versions": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Kubernetes api versions used for Capabilities.APIVersions.",
+			},
+			"kube_version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Kubernetes version used for Capabilities.KubeVersion.",
+			},
+			"include_crds": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Include CRDs in the templated output.",
+			},
+			"manifest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Rendered manifests as YAML, concatenated in install order.",
+			},
+			"manifests": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Map of rendered hook manifests, keyed by the chart template path that produced them.",
+			},
+		},
+	}
+}
+
+func dataTemplateRead(d *schema.ResourceData, meta interface{}) error {
+	m := meta.(*Meta)
+
+	actionConfig := new(action.Configuration)
+	client := action.NewInstall(actionConfig)
+
+	client.ReleaseName = d.Get("name").(string)
+	client.Namespace = d.Get("namespace").(string)
+	client.ClientOnly = true
+	client.DryRun = true
+	client.Replace = true
+	client.IncludeCRDs = d.Get("include_crds").(bool)
+	client.ChartPathOptions.RepoURL = d.Get("repository").(string)
+
+	if v, ok := d.GetOk("version"); ok {
+		client.Version = v.(string)
+	} else if d.Get("devel").(bool) {
+		client.Version = ">0.0.0-0"
+	}
+
+	if v, ok := d.GetOk("kube_version"); ok {
+		kubeVersion, err := chartutil.ParseKubeVersion(v.(string))
+		if err != nil {
+			return fmt.Errorf("could not parse kube_version: %s", err)
+		}
+		client.KubeVersion = kubeVersion
+	}
+
+	if v, ok := d.GetOk("api_versions"); ok {
+		apiVersions := make(chartutil.VersionSet, 0)
+		for _, a := range v.([]interface{}) {
+			apiVersions = append(apiVersions, a.(string))
+		}
+		client.APIVersions = apiVersions
+	}
+
+	chrt, err := loadChart(m, client.ChartPathOptions, d.Get("chart").(string))
+	if err != nil {
+		return err
+	}
+
+	values, err := templateGetValues(d)
+	if err != nil {
+		return err
+	}
+
+	rel, err := client.Run(chrt, values)
+	if err != nil {
+		return fmt.Errorf("error rendering chart: %s", err)
+	}
+
+	manifests := make(map[string]string, len(rel.Hooks))
+	for _, hook := range rel.Hooks {
+		manifests[hook.Path] = hook.Manifest
+	}
+
+	d.Set("manifest", strings.TrimSpace(rel.Manifest))
+	d.Set("manifests", manifests)
+	d.SetId(fmt.Sprintf("%s/%s", client.Namespace, client.ReleaseName))
+
+	return nil
+}
+
+func templateGetValues(d *schema.ResourceData) (map[string]interface{}, error) {
+	base := map[string]interface{}{}
+
+	for _, raw := range d.Get("values").([]interface{}) {
+		values := raw.(string)
+		if values == "" {
+			continue
+		}
+
+		currentMap := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(values), &currentMap); err != nil {
+			return nil, fmt.Errorf("error parsing values: %s", err)
+		}
+
+		for k, v := range currentMap {
+			currentMap[k] = stringifyMapKeys(v)
+		}
+
+		base = mergeMaps(base, currentMap)
+	}
+
+	for _, raw := range d.Get("set").(*schema.Set).List() {
+		set := raw.(map[string]interface{})
+		if err := templateGetValue(base, set); err != nil {
+			return nil, err
+		}
+	}
+
+	return base, nil
+}
+
+func templateGetValue(base map[string]interface{}, set map[string]interface{}) error {
+	name := set["name"].(string)
+	value := set["value"].(string)
+
+	switch set["type"].(string) {
+	case "string":
+		if err := strvals.ParseIntoString(fmt.Sprintf("%s=%s", name, value), base); err != nil {
+			return fmt.Errorf("failed parsing key %q with value %s: %s", name, value, err)
+		}
+	default:
+		if err := strvals.ParseInto(fmt.Sprintf("%s=%s", name, value), base); err != nil {
+			return fmt.Errorf("failed parsing key %q with value %s: %s", name, value, err)
+		}
+	}
+
+	return nil
+}
+
+// stringifyMapKeys recursively converts the map[interface{}]interface{}
+// values gopkg.in/yaml.v2 produces for nested mappings into
+// map[string]interface{}, so mergeMaps's type assertion can see them as
+// nested maps instead of clobbering them.
+func stringifyMapKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[fmt.Sprintf("%v", k)] = stringifyMapKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range v {
+			v[i] = stringifyMapKeys(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if bv, ok := v.(map[string]interface{}); ok {
+			if av, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeMaps(av, bv)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// acquireReleaseLock serializes helm operations run through this provider
+// instance. The namespace argument is not used: every operation contends
+// for the one Lease named by LockConfig, whatever namespace the release
+// targets. When the provider's `lock` block is disabled it is backed
+// only by Meta's embedded in-process Mutex, which the caller is
+// expected to already hold. When enabled, it additionally acquires a
+// coordination.k8s.io/v1 Lease, so that concurrent Terraform runs (e.g.
+// separate CI runners or Terraform Cloud workers) targeting the same
+// cluster serialize against each other too.
+//
+// It returns a release func that must be called exactly once, and never
+// returns an error alongside a nil release func.
+func (m *Meta) acquireReleaseLock(namespace string) (func(), error) {
+	noop := func() {}
+
+	if !m.LockConfig.Enabled {
+		return noop, nil
+	}
+
+	restConfig, err := m.RESTClientGetter.ToRESTConfig()
+	if err != nil {
+		return noop, fmt.Errorf("could not build REST config for release lock: %s", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return noop, fmt.Errorf("could not build Kubernetes client for release lock: %s", err)
+	}
+
+	leases := clientset.CoordinationV1().Leases(m.LockConfig.Namespace)
+
+	holder := fmt.Sprintf("%s-%d", hostnameOrUnknown(), os.Getpid())
+
+	// An abandoned lease only becomes reclaimable once RenewTime+TTL has
+	// elapsed (see leaseIsExpired), so the wait has to cover at least TTL;
+	// RenewDeadline alone is a per-call API budget and, with the defaults,
+	// is shorter than TTL, which meant a waiter always gave up before a
+	// crashed holder's lease could ever be reclaimed. Add RenewDeadline on
+	// top as slack for the retry loop's own API calls.
+	ctx, cancel := context.WithTimeout(context.Background(), m.LockConfig.TTL+m.LockConfig.RenewDeadline)
+	defer cancel()
+
+	if err := acquireLease(ctx, leases, m.LockConfig, holder); err != nil {
+		return noop, err
+	}
+
+	stopRenewal := make(chan struct{})
+	if m.LockConfig.TTL > 0 {
+		go renewLeaseUntil(leases, m.LockConfig, holder, stopRenewal)
+	}
+
+	release := func() {
+		close(stopRenewal)
+
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), m.LockConfig.RenewDeadline)
+		defer releaseCancel()
+
+		if err := leases.Delete(releaseCtx, m.LockConfig.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("[WARN] could not release lease %s/%s: %s", m.LockConfig.Namespace, m.LockConfig.Name, err)
+		}
+	}
+
+	return release, nil
+}
+
+// renewLeaseUntil keeps the Lease's RenewTime fresh every TTL/2 for as
+// long as the operation is running, so that an install/upgrade that runs
+// longer than TTL doesn't look abandoned to a competing run. It stops as
+// soon as stop is closed by release().
+func renewLeaseUntil(leases coordinationv1client.LeaseInterface, cfg LockConfig, holder string, stop <-chan struct{}) {
+	ticker := time.NewTicker(cfg.TTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := renewLease(leases, cfg, holder); err != nil {
+				log.Printf("[WARN] could not renew lease %s/%s: %s", cfg.Namespace, cfg.Name, err)
+			}
+		}
+	}
+}
+
+func renewLease(leases coordinationv1client.LeaseInterface, cfg LockConfig, holder string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RenewDeadline)
+	defer cancel()
+
+	lease, err := leases.Get(ctx, cfg.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get lease %s/%s: %s", cfg.Namespace, cfg.Name, err)
+	}
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return fmt.Errorf("lease %s/%s is no longer held by %s", cfg.Namespace, cfg.Name, holder)
+	}
+
+	lease.Spec.RenewTime = nowMicroTime()
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func acquireLease(ctx context.Context, leases coordinationv1client.LeaseInterface, cfg LockConfig, holder string) error {
+	durationSeconds := int32(cfg.TTL.Seconds())
+
+	for {
+		existing, err := leases.Get(ctx, cfg.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			_, err := leases.Create(ctx, newLease(cfg.Name, holder, durationSeconds), metav1.CreateOptions{})
+			if err == nil {
+				return nil
+			}
+			if !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("could not create lease %s/%s: %s", cfg.Namespace, cfg.Name, err)
+			}
+		case err != nil:
+			return fmt.Errorf("could not get lease %s/%s: %s", cfg.Namespace, cfg.Name, err)
+		case leaseIsExpired(existing):
+			existing.Spec.HolderIdentity = &holder
+			existing.Spec.AcquireTime = nowMicroTime()
+			existing.Spec.RenewTime = nowMicroTime()
+			existing.Spec.LeaseDurationSeconds = &durationSeconds
+			if _, err := leases.Update(ctx, existing, metav1.UpdateOptions{}); err == nil {
+				return nil
+			}
+		case existing.Spec.HolderIdentity != nil && *existing.Spec.HolderIdentity == holder:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting to acquire lease %s/%s: %s", cfg.Namespace, cfg.Name, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func leaseIsExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+func newLease(name, holder string, durationSeconds int32) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			AcquireTime:          nowMicroTime(),
+			RenewTime:            nowMicroTime(),
+			LeaseDurationSeconds: &durationSeconds,
+		},
+	}
+}
+
+func nowMicroTime() *metav1.MicroTime {
+	now := metav1.NewMicroTime(time.Now())
+	return &now
+}
+
+func hostnameOrUnknown() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
@@ -3,8 +3,14 @@ package helm
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
@@ -15,21 +21,40 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/registry"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // Meta is the meta information structure for the provider
 type Meta struct {
-	data        *schema.ResourceData
-	Settings    *cli.EnvSettings
-	ConfigFlags *genericclioptions.ConfigFlags
-	HelmDriver  string
+	data             *schema.ResourceData
+	Settings         *cli.EnvSettings
+	ConfigFlags      *genericclioptions.ConfigFlags
+	RESTClientGetter genericclioptions.RESTClientGetter
+	RegistryClient   *registry.Client
+	HelmDriver       string
+	LockConfig       LockConfig
+	MaxHistory       int
 
 	// Used to lock some operations
 	sync.Mutex
 }
 
+// LockConfig describes how release operations against this provider
+// instance should be serialized. When Enabled is false, only the
+// in-process Mutex embedded in Meta applies.
+type LockConfig struct {
+	Enabled       bool
+	Namespace     string
+	Name          string
+	TTL           time.Duration
+	RenewDeadline time.Duration
+}
+
 // Provider returns the provider schema to Terraform.
 func Provider() terraform.ResourceProvider {
 	p := &schema.Provider{
@@ -93,6 +118,24 @@ func Provider() terraform.ResourceProvider {
 				Description: "The namespace helm stores release information in.",
 				DefaultFunc: schema.EnvDefaultFunc("HELM_NAMESPACE", "default"),
 			},
+			"burst_limit": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Helm burst limit. Increase this if you have a cluster with many CRDs.",
+				DefaultFunc: schema.EnvDefaultFunc("HELM_BURST_LIMIT", 100),
+			},
+			"qps": {
+				Type:        schema.TypeFloat,
+				Optional:    true,
+				Description: "Helm client-side rate limit, in queries per second. Unset (0) keeps the client-go default.",
+				DefaultFunc: schema.EnvDefaultFunc("HELM_QPS", float64(0)),
+			},
+			"max_history": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Maximum number of release versions stored per release. 0 means no limit.",
+				DefaultFunc: schema.EnvDefaultFunc("HELM_MAX_HISTORY", 10),
+			},
 			"kubernetes": {
 				Type:        schema.TypeList,
 				MaxItems:    1,
@@ -100,13 +143,28 @@ func Provider() terraform.ResourceProvider {
 				Description: "Kubernetes configuration.",
 				Elem:        kubernetesResource(),
 			},
+			"registry": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "OCI registries to log into before running any release against an `oci://` chart.",
+				Elem:        registryResource(),
+			},
+			"lock": {
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				Optional:    true,
+				Description: "Coordinate concurrent Terraform runs against the same cluster using a Kubernetes Lease.",
+				Elem:        lockResource(),
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"helm_release":    resourceRelease(),
-			"helm_repository": resourceRepository(),
+			"helm_release":        resourceRelease(),
+			"helm_repository":     resourceRepository(),
+			"helm_registry_login": resourceRegistryLogin(),
 		},
 		DataSourcesMap: map[string]*schema.Resource{
 			"helm_repository": dataRepository(),
+			"helm_template":   dataTemplate(),
 		},
 	}
 	p.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
@@ -172,6 +230,42 @@ func kubernetesResource() *schema.Resource {
 				DefaultFunc: schema.EnvDefaultFunc("KUBE_CLUSTER_CA_CERT_DATA", ""),
 				Description: "PEM-encoded root certificates bundle for TLS authentication. Can be sourced from `KUBE_CLUSTER_CA_CERT_DATA`.",
 			},
+			"insecure_skip_tls_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_INSECURE_SKIP_TLS_VERIFY", false),
+				Description: "Whether to skip verifying the TLS certificate presented by the kube-apiserver, without disabling TLS entirely. Can be sourced from `KUBE_INSECURE_SKIP_TLS_VERIFY`.",
+			},
+			"tls_server_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_TLS_SERVER_NAME", ""),
+				Description: "Server name passed to the server for SNI and used in the client to check server certificates against, overriding the one set by `host`. Can be sourced from `KUBE_TLS_SERVER_NAME`.",
+			},
+			"proxy_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_PROXY_URL", ""),
+				Description: "URL to the proxy to be used for all requests made by this client. Can be sourced from `KUBE_PROXY_URL`.",
+			},
+			"exec_as_user": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("HELM_KUBEASUSER", ""),
+				Description: "Username to impersonate for the operation. Matches the Helm CLI `--kube-as-user` flag. Can be sourced from `HELM_KUBEASUSER`.",
+			},
+			"exec_as_groups": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Group names to impersonate for the operation. Matches the Helm CLI `--kube-as-group` flag. Can be sourced from `HELM_KUBEASGROUP`.",
+			},
+			"exec_as_uid": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("HELM_KUBEASUSER_UID", ""),
+				Description: "UID to impersonate for the operation.",
+			},
 			"config_path": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -183,6 +277,12 @@ func kubernetesResource() *schema.Resource {
 					"~/.kube/config"),
 				Description: "Path to the kube config file, defaults to ~/.kube/config. Can be sourced from `KUBE_CONFIG`.",
 			},
+			"config_paths": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "A list of paths to kube config files, merged together following standard kubeconfig precedence rules before context selection. Can be sourced from `KUBE_CONFIG_PATHS`.",
+			},
 			"config_context": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -200,6 +300,109 @@ func kubernetesResource() *schema.Resource {
 				DefaultFunc: schema.EnvDefaultFunc("KUBE_LOAD_CONFIG_FILE", true),
 				Description: "By default the local config (~/.kube/config) is loaded when you use this provider. This option at false disable this behaviour.",
 			},
+			"exec": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Exec-based plugin for obtaining credentials, e.g. aws eks get-token, gcloud, or the AWS IAM Authenticator.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"api_version": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "API version of the exec credential plugin, e.g. `client.authentication.k8s.io/v1beta1`.",
+						},
+						"command": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "Command to execute to obtain credentials.",
+						},
+						"args": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Arguments to pass to the command.",
+						},
+						"env": {
+							Type:        schema.TypeMap,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Environment variables to set when executing the command.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func registryResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"url": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "OCI registry URL, e.g. `registry-1.docker.io`.",
+			},
+			"username": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "Username to log into the OCI registry with.",
+			},
+			"password": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				Description: "Password or token to log into the OCI registry with.",
+			},
+			"ca_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Path to a CA bundle used to verify the registry's certificate.",
+			},
+			"insecure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether to allow connecting to the registry over plain HTTP or with an unverified TLS certificate.",
+			},
+		},
+	}
+}
+
+func lockResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"enabled": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Serialize release operations against this cluster/namespace using a coordination.k8s.io Lease instead of only an in-process mutex.",
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "default",
+				Description: "Namespace to create the Lease in.",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "terraform-provider-helm",
+				Description: "Name of the Lease used to coordinate runs.",
+			},
+			"ttl": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "20s",
+				Description: "How long a held Lease is considered valid without being renewed, as a Go duration string.",
+			},
+			"renew_deadline": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "15s",
+				Description: "Time allowed for each Lease API call made while renewing or releasing the Lease, as a Go duration string. Acquiring the Lease waits up to ttl plus renew_deadline before giving up.",
+			},
 		},
 	}
 }
@@ -241,9 +444,77 @@ func (m *Meta) buildSettings(d *schema.ResourceData) error {
 		m.HelmDriver = v.(string)
 	}
 
+	if v, ok := d.GetOk("max_history"); ok {
+		m.MaxHistory = v.(int)
+	}
+
 	m.Settings = &settings
 	m.getK8sConfig(d)
 
+	if err := m.buildLockConfig(d); err != nil {
+		return err
+	}
+
+	return m.buildRegistryClient(d)
+}
+
+func (m *Meta) buildLockConfig(d *schema.ResourceData) error {
+	if _, ok := d.GetOk("lock.0.enabled"); !ok {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(d.Get("lock.0.ttl").(string))
+	if err != nil {
+		return fmt.Errorf("invalid lock.ttl: %s", err)
+	}
+
+	renewDeadline, err := time.ParseDuration(d.Get("lock.0.renew_deadline").(string))
+	if err != nil {
+		return fmt.Errorf("invalid lock.renew_deadline: %s", err)
+	}
+
+	m.LockConfig = LockConfig{
+		Enabled:       d.Get("lock.0.enabled").(bool),
+		Namespace:     d.Get("lock.0.namespace").(string),
+		Name:          d.Get("lock.0.name").(string),
+		TTL:           ttl,
+		RenewDeadline: renewDeadline,
+	}
+
+	return nil
+}
+
+func (m *Meta) buildRegistryClient(d *schema.ResourceData) error {
+	opts := []registry.ClientOption{
+		registry.ClientOptDebug(m.Settings.Debug),
+		registry.ClientOptWriter(log.Writer()),
+		registry.ClientOptCredentialsFile(m.Settings.RegistryConfig),
+	}
+
+	client, err := registry.NewClient(opts...)
+	if err != nil {
+		return fmt.Errorf("could not build OCI registry client: %s", err)
+	}
+
+	if v, ok := d.GetOk("registry"); ok {
+		for _, raw := range v.([]interface{}) {
+			reg := raw.(map[string]interface{})
+
+			loginOpts := []registry.LoginOption{
+				registry.LoginOptBasicAuth(reg["username"].(string), reg["password"].(string)),
+				registry.LoginOptInsecure(reg["insecure"].(bool)),
+			}
+			if caFile, ok := reg["ca_file"].(string); ok && caFile != "" {
+				loginOpts = append(loginOpts, registry.LoginOptTLSClientConfig("", "", caFile))
+			}
+
+			if err := client.Login(reg["url"].(string), loginOpts...); err != nil {
+				return fmt.Errorf("could not log into OCI registry %q: %s", reg["url"], err)
+			}
+		}
+	}
+
+	m.RegistryClient = client
 	return nil
 }
 
@@ -282,8 +553,33 @@ func k8sGet(d *schema.ResourceData, key string) interface{} {
 func (m *Meta) getK8sConfig(d *schema.ResourceData) error {
 	cf := genericclioptions.NewConfigFlags(true)
 
+	var configPaths []string
+
 	// Not sure if in_cluster is still valid here.
 	if !k8sGet(d, "in_cluster").(bool) && k8sGet(d, "load_config_file").(bool) {
+		if v, ok := d.GetOk(k8sPrefix + "config_paths"); ok {
+			for _, p := range v.([]interface{}) {
+				expanded, err := homedir.Expand(p.(string))
+				if err != nil {
+					debug("Error expanding path %s", err)
+					return err
+				}
+				configPaths = append(configPaths, expanded)
+			}
+		} else if v := os.Getenv("KUBE_CONFIG_PATHS"); v != "" {
+			// DefaultFunc is not triggered for a TypeList nested inside the
+			// "kubernetes" block, so KUBE_CONFIG_PATHS is applied by hand
+			// when the attribute itself is unset.
+			for _, p := range filepath.SplitList(v) {
+				expanded, err := homedir.Expand(p)
+				if err != nil {
+					debug("Error expanding path %s", err)
+					return err
+				}
+				configPaths = append(configPaths, expanded)
+			}
+		}
+
 		if v, ok := k8sGetOk(d, "config_path"); ok {
 			v := v.(string)
 
@@ -293,6 +589,10 @@ func (m *Meta) getK8sConfig(d *schema.ResourceData) error {
 				return err
 			}
 			cf.KubeConfig = &expanded
+
+			if len(configPaths) == 0 {
+				configPaths = []string{expanded}
+			}
 		}
 	}
 
@@ -308,59 +608,264 @@ func (m *Meta) getK8sConfig(d *schema.ResourceData) error {
 
 	if v, ok := k8sGetOk(d, "username"); ok {
 		v := v.(string)
-		m.ConfigFlags.Username = &v
+		cf.Username = &v
 	}
 
 	if v, ok := k8sGetOk(d, "password"); ok {
 		v := v.(string)
-		m.ConfigFlags.Username = &v
+		cf.Password = &v
 	}
 
 	if v, ok := k8sGetOk(d, "token"); ok {
 		v := v.(string)
-		m.ConfigFlags.BearerToken = &v
+		cf.BearerToken = &v
 	}
 
 	if v, ok := k8sGetOk(d, "insecure"); ok {
 		v := v.(bool)
-		m.ConfigFlags.Insecure = &v
+		cf.Insecure = &v
 	}
 
 	if v, ok := k8sGetOk(d, "client_certificate"); ok {
 		v := v.(string)
-		m.ConfigFlags.CertFile = &v
+		cf.CertFile = &v
 	}
 
 	if v, ok := k8sGetOk(d, "client_key"); ok {
 		v := v.(string)
-		m.ConfigFlags.KeyFile = &v
+		cf.KeyFile = &v
 	}
 
 	if v, ok := k8sGetOk(d, "cluster_ca_certificate"); ok {
 		v := v.(string)
-		m.ConfigFlags.CAFile = &v
+		cf.CAFile = &v
 	}
 
 	if v, ok := k8sGetOk(d, "host"); ok {
 		v := v.(string)
-		m.ConfigFlags.ClusterName = &v
+		cf.ClusterName = &v
+	}
+
+	if v, ok := k8sGetOk(d, "insecure_skip_tls_verify"); ok {
+		v := v.(bool)
+		cf.Insecure = &v
+	}
+
+	if v, ok := k8sGetOk(d, "tls_server_name"); ok {
+		v := v.(string)
+		cf.TLSServerName = &v
+	}
+
+	var proxyURL string
+	if v, ok := k8sGetOk(d, "proxy_url"); ok {
+		proxyURL = v.(string)
+	}
+
+	if v, ok := k8sGetOk(d, "exec_as_user"); ok {
+		v := v.(string)
+		cf.Impersonate = &v
+	}
+
+	// As with config_paths above, DefaultFunc is not triggered for a
+	// TypeList nested inside the "kubernetes" block, so HELM_KUBEASGROUP
+	// is applied by hand when the attribute itself is unset.
+	if v, ok := d.GetOk(k8sPrefix + "exec_as_groups"); ok {
+		var groups []string
+		for _, g := range v.([]interface{}) {
+			groups = append(groups, g.(string))
+		}
+		cf.ImpersonateGroup = &groups
+	} else if env := os.Getenv("HELM_KUBEASGROUP"); env != "" {
+		groups := strings.Split(env, ",")
+		cf.ImpersonateGroup = &groups
+	}
+
+	if v, ok := k8sGetOk(d, "exec_as_uid"); ok {
+		v := v.(string)
+		cf.ImpersonateUID = &v
 	}
 
 	m.ConfigFlags = cf
+
+	var execConfig *clientcmdapi.ExecConfig
+	if v, ok := d.GetOk(k8sPrefix + "exec.0.command"); ok {
+		execConfig = &clientcmdapi.ExecConfig{
+			APIVersion: d.Get(k8sPrefix + "exec.0.api_version").(string),
+			Command:    v.(string),
+		}
+
+		for _, arg := range d.Get(k8sPrefix + "exec.0.args").([]interface{}) {
+			execConfig.Args = append(execConfig.Args, arg.(string))
+		}
+
+		for envName, envValue := range d.Get(k8sPrefix + "exec.0.env").(map[string]interface{}) {
+			execConfig.Env = append(execConfig.Env, clientcmdapi.ExecEnvVar{Name: envName, Value: envValue.(string)})
+		}
+	}
+
+	m.RESTClientGetter = &kubeConfigGetter{
+		ConfigFlags: cf,
+		configPaths: configPaths,
+		exec:        execConfig,
+		proxyURL:    proxyURL,
+		burstLimit:  d.Get("burst_limit").(int),
+		qps:         float32(d.Get("qps").(float64)),
+	}
+
 	return nil
 }
 
-// GetHelmConfiguration will return a new Helm configuration
-func (m *Meta) GetHelmConfiguration(namespace string) (*action.Configuration, error) {
+// kubeConfigGetter wraps genericclioptions.ConfigFlags so that the
+// resulting client config can merge multiple kubeconfig files (following
+// standard kubeconfig precedence rules), inject an exec-based credential
+// plugin, and route requests through an HTTPS proxy, none of which
+// ConfigFlags supports on its own.
+type kubeConfigGetter struct {
+	*genericclioptions.ConfigFlags
+	configPaths []string
+	exec        *clientcmdapi.ExecConfig
+	proxyURL    string
+	burstLimit  int
+	qps         float32
+}
+
+func (k *kubeConfigGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if len(k.configPaths) > 0 {
+		rules.Precedence = k.configPaths
+	}
+
+	// Mirror the overrides ConfigFlags.ToRawKubeConfigLoader would apply for
+	// the fields getK8sConfig sets (APIServer, AuthInfoName and Timeout are
+	// not carried over), so that routing through this merged/exec-aware loader
+	// (done whenever configPaths or exec is set) doesn't silently drop the
+	// TLS/impersonation/basic-auth settings layered onto ConfigFlags by
+	// getK8sConfig.
+	overrides := &clientcmd.ConfigOverrides{}
+	if k.BearerToken != nil {
+		overrides.AuthInfo.Token = *k.BearerToken
+	}
+	if k.Impersonate != nil {
+		overrides.AuthInfo.Impersonate = *k.Impersonate
+	}
+	if k.ImpersonateUID != nil {
+		overrides.AuthInfo.ImpersonateUID = *k.ImpersonateUID
+	}
+	if k.ImpersonateGroup != nil {
+		overrides.AuthInfo.ImpersonateGroups = *k.ImpersonateGroup
+	}
+	if k.ClusterName != nil {
+		overrides.Context.Cluster = *k.ClusterName
+	}
+	if k.Namespace != nil {
+		overrides.Context.Namespace = *k.Namespace
+	}
+	if k.TLSServerName != nil {
+		overrides.ClusterInfo.TLSServerName = *k.TLSServerName
+	}
+	if k.CertFile != nil {
+		overrides.AuthInfo.ClientCertificate = *k.CertFile
+	}
+	if k.KeyFile != nil {
+		overrides.AuthInfo.ClientKey = *k.KeyFile
+	}
+	if k.CAFile != nil {
+		overrides.ClusterInfo.CertificateAuthority = *k.CAFile
+	}
+	if k.Insecure != nil {
+		overrides.ClusterInfo.InsecureSkipTLSVerify = *k.Insecure
+	}
+	if k.Username != nil {
+		overrides.AuthInfo.Username = *k.Username
+	}
+	if k.Password != nil {
+		overrides.AuthInfo.Password = *k.Password
+	}
+	if k.Context != nil {
+		overrides.CurrentContext = *k.Context
+	}
+	if k.exec != nil {
+		overrides.AuthInfo.Exec = k.exec
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+func (k *kubeConfigGetter) ToRESTConfig() (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+
+	if len(k.configPaths) > 0 || k.exec != nil {
+		// Go through the merged/exec-aware loader so config_paths and the
+		// exec block actually affect the REST config used to talk to the
+		// apiserver, instead of only the raw kubeconfig.
+		config, err = k.ToRawKubeConfigLoader().ClientConfig()
+	} else {
+		config, err = k.ConfigFlags.ToRESTConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if k.proxyURL != "" {
+		proxyURL, err := url.Parse(k.proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %s", err)
+		}
+		config.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if k.burstLimit > 0 {
+		config.Burst = k.burstLimit
+	}
+
+	if k.qps > 0 {
+		config.QPS = k.qps
+	}
+
+	return config, nil
+}
+
+// GetHelmConfiguration will return a new Helm configuration, plus a Close
+// func the caller must invoke once done with it. When the provider's `lock`
+// block is enabled, Close releases the Kubernetes Lease serializing this
+// operation against other Terraform runs; otherwise it just releases the
+// in-process Mutex.
+func (m *Meta) GetHelmConfiguration(namespace string) (*action.Configuration, func(), error) {
 	m.Lock()
-	defer m.Unlock()
+
+	release, err := m.acquireReleaseLock(namespace)
+	if err != nil {
+		m.Unlock()
+		return nil, nil, err
+	}
+
+	// closeFunc is idempotent so it's safe to call it both from a caller's
+	// `defer closeFunc()` and, as a safety net for a caller that forgets
+	// to, from the finalizer below once actionConfig is garbage collected.
+	var once sync.Once
+	closeFunc := func() {
+		once.Do(func() {
+			release()
+			m.Unlock()
+		})
+	}
 
 	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(m.ConfigFlags, namespace, m.HelmDriver, debug); err != nil {
-		return nil, err
+	if err := actionConfig.Init(m.RESTClientGetter, namespace, m.HelmDriver, debug); err != nil {
+		closeFunc()
+		return nil, nil, err
+	}
+	actionConfig.RegistryClient = m.RegistryClient
+	if m.MaxHistory > 0 {
+		actionConfig.Releases.MaxHistory = m.MaxHistory
 	}
 
-	return actionConfig, nil
+	runtime.SetFinalizer(actionConfig, func(*action.Configuration) {
+		closeFunc()
+	})
+
+	return actionConfig, closeFunc, nil
 }
 
 func debug(format string, a ...interface{}) {
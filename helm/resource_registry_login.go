@@ -0,0 +1,99 @@
+package helm
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// resourceRegistryLogin manages a logged-in session against a single OCI
+// registry, on top of whatever registries were already configured via the
+// provider's `registry` blocks. This is useful when the credentials for a
+// registry are only known at apply time, e.g. a token minted by another
+// resource.
+func resourceRegistryLogin() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceRegistryLoginCreate,
+		Read:   resourceRegistryLoginRead,
+		Delete: resourceRegistryLoginDelete,
+
+		Schema: map[string]*schema.Schema{
+			"url": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "OCI registry URL, e.g. `registry-1.docker.io`.",
+			},
+			"username": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "Username to log into the OCI registry with.",
+			},
+			"password": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Sensitive:   true,
+				Description: "Password or token to log into the OCI registry with.",
+			},
+			"ca_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Path to a CA bundle used to verify the registry's certificate.",
+			},
+			"insecure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     false,
+				Description: "Whether to allow connecting to the registry over plain HTTP or with an unverified TLS certificate.",
+			},
+		},
+	}
+}
+
+func resourceRegistryLoginCreate(d *schema.ResourceData, meta interface{}) error {
+	m := meta.(*Meta)
+
+	if m.RegistryClient == nil {
+		return fmt.Errorf("no OCI registry client configured")
+	}
+
+	url := d.Get("url").(string)
+
+	opts := []registry.LoginOption{
+		registry.LoginOptBasicAuth(d.Get("username").(string), d.Get("password").(string)),
+		registry.LoginOptInsecure(d.Get("insecure").(bool)),
+	}
+	if caFile := d.Get("ca_file").(string); caFile != "" {
+		opts = append(opts, registry.LoginOptTLSClientConfig("", "", caFile))
+	}
+
+	if err := m.RegistryClient.Login(url, opts...); err != nil {
+		return fmt.Errorf("could not log into OCI registry %q: %s", url, err)
+	}
+
+	d.SetId(url)
+	return resourceRegistryLoginRead(d, meta)
+}
+
+func resourceRegistryLoginRead(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
+
+func resourceRegistryLoginDelete(d *schema.ResourceData, meta interface{}) error {
+	m := meta.(*Meta)
+
+	if m.RegistryClient == nil {
+		return nil
+	}
+
+	if err := m.RegistryClient.Logout(d.Id()); err != nil {
+		return fmt.Errorf("could not log out of OCI registry %q: %s", d.Id(), err)
+	}
+
+	return nil
+}